@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// replicationLagState describes the classification assigned to the most
+// recently observed replica lag, and drives how the adaptive rate is
+// adjusted on the next tick.
+type replicationLagState string
+
+const (
+	lagStateIncrease  replicationLagState = "increase"
+	lagStateDecrease  replicationLagState = "decrease"
+	lagStateEmergency replicationLagState = "emergency"
+	lagStateHold      replicationLagState = "hold"
+)
+
+// ReplicationLagModuleConfig holds configuration for the adaptive throttle
+// module. It's modeled on Vitess's MaxReplicationLagModule: rather than
+// holding a static override rate, the module continuously probes for
+// headroom and backs off when observed replica lag approaches a configured
+// maximum.
+type ReplicationLagModuleConfig struct {
+	// Enabled determines whether the adaptive module is actively adjusting
+	// the throttle override.
+	Enabled bool
+	// MaxReplicationLagSec is the maximum tolerable replica lag, in seconds.
+	// Lag at or above this value triggers the emergency state.
+	MaxReplicationLagSec float64
+	// InitialRate is the starting throttle rate in MB/s, used on first tick
+	// and after a reconfigure.
+	InitialRate float64
+	// MaxRateApproachThreshold is the fraction of MaxReplicationLagSec
+	// (0.0-1.0) below which the module probes the rate upward. Between this
+	// and EmergencyDecreaseThreshold the rate is held.
+	MaxRateApproachThreshold float64
+	// EmergencyDecreaseThreshold is the fraction of MaxReplicationLagSec
+	// (0.0-1.0) at or above which the module backs off proportionally to
+	// observed lag / MaxReplicationLagSec. The sharp emergency cut is
+	// triggered by MaxReplicationLagSec itself, not by this threshold.
+	EmergencyDecreaseThreshold float64
+	// AgeBadRateAfterSec is how long a rate selected during an emergency is
+	// remembered as a "bad rate" and excluded from probing back upward.
+	AgeBadRateAfterSec int
+	// Interval is how often the module polls replica lag and re-evaluates
+	// the rate.
+	Interval time.Duration
+}
+
+// replicationLagTransition records the outcome of a single evaluation tick,
+// surfaced via the /throttle/adaptive GET endpoint for observability.
+type replicationLagTransition struct {
+	State       replicationLagState
+	Rate        float64
+	TargetLag   float64
+	ObservedLag float64
+	Reason      string
+	Timestamp   time.Time
+}
+
+// badRate remembers a rate that was selected in response to an emergency
+// and the time it should age out.
+type badRate struct {
+	rate     float64
+	expireAt time.Time
+}
+
+// replicationLagModule implements the adaptive throttle loop described in
+// ReplicationLagModuleConfig. It publishes the rate it selects back through
+// setThrottleOverride so that existing consumers of the override znode
+// continue to work unmodified.
+type replicationLagModule struct {
+	sync.Mutex
+
+	cfg   ReplicationLagModuleConfig
+	store ThrottleStore
+
+	rate           float64
+	lastTransition replicationLagTransition
+	badRates       []badRate
+
+	// lagFunc returns the current observed replica lag in seconds. It's a
+	// field rather than a hard dependency on kafkametrics so the module can
+	// be exercised in tests with a fake clock of lag values.
+	lagFunc func() (float64, error)
+
+	// headroom returns the upper bound (MB/s) the module is not allowed to
+	// exceed, sourced from Limits.replicationHeadroom.
+	headroom func() (float64, error)
+
+	// brokerSample, if set, is called once per tick to issue a lightweight
+	// admin request through a brokerthrottle.Recorder, so broker-reported
+	// throttle_time_ms gets sampled on the same cadence as lag.
+	brokerSample func() error
+
+	// lastWrittenRate and haveLastWrittenRate track the int rate tick() most
+	// recently wrote via setThrottleOverride, so onExternalOverride can tell
+	// the module's own write, echoed back through the same watch channel
+	// it's subscribed to, apart from a genuine operator-initiated change.
+	lastWrittenRate     int
+	haveLastWrittenRate bool
+
+	running bool
+	stop    chan struct{}
+
+	// watch receives an event whenever the global override is mutated,
+	// including by this module's own tick; onExternalOverride ignores those
+	// and adopts other changes (e.g. an operator POSTing /throttle
+	// directly). It's created lazily on first Start and reused
+	// across subsequent Start/Stop cycles, since ThrottleStore has no way to
+	// unsubscribe a single Watch call.
+	watch <-chan ThrottleStoreEvent
+}
+
+// newReplicationLagModule returns a replicationLagModule configured per cfg.
+// It does not start the polling loop; call Start for that.
+func newReplicationLagModule(cfg ReplicationLagModuleConfig, store ThrottleStore, lagFunc func() (float64, error), headroom func() (float64, error), brokerSample func() error) *replicationLagModule {
+	return &replicationLagModule{
+		cfg:          cfg,
+		store:        store,
+		rate:         cfg.InitialRate,
+		lagFunc:      lagFunc,
+		headroom:     headroom,
+		brokerSample: brokerSample,
+	}
+}
+
+// Start begins the background polling loop. It's a no-op if the module is
+// not enabled, or if it's already running. A fresh stop channel is created
+// each time so that a prior Stop doesn't leave the next Start selecting on
+// an already-closed channel.
+func (m *replicationLagModule) Start() {
+	m.Lock()
+	if !m.cfg.Enabled || m.running {
+		m.Unlock()
+		return
+	}
+
+	if m.cfg.Interval <= 0 {
+		// time.NewTicker below panics on a non-positive duration. The POST
+		// handler rejects this on reconfigure, but this guards the same
+		// invariant for a module started directly from a zero-value or
+		// otherwise unvalidated config (e.g. at initAPI startup).
+		m.Unlock()
+		log.Printf("adaptive throttle: not starting, Interval must be > 0\n")
+		return
+	}
+
+	if m.watch == nil {
+		m.watch = m.store.Watch(overrideRateZnodePath)
+	}
+	watch := m.watch
+
+	stop := make(chan struct{})
+	m.stop = stop
+	m.running = true
+	m.Unlock()
+
+	go func() {
+		t := time.NewTicker(m.cfg.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				m.tick()
+			case ev, ok := <-watch:
+				if !ok {
+					// The store was closed; stop selecting on this channel
+					// rather than busy-looping on further closed-channel
+					// reads.
+					watch = nil
+					continue
+				}
+				m.onExternalOverride(ev)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background polling loop. It's a no-op if the module
+// isn't currently running.
+func (m *replicationLagModule) Stop() {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.running {
+		return
+	}
+
+	close(m.stop)
+	m.running = false
+}
+
+// tick polls replica lag, classifies it into a state, computes the next
+// rate, and publishes it via setThrottleOverride.
+func (m *replicationLagModule) tick() {
+	lag, err := m.lagFunc()
+	if err != nil {
+		log.Printf("adaptive throttle: error polling replication lag: %s\n", err)
+		return
+	}
+
+	if m.brokerSample != nil {
+		if err := m.brokerSample(); err != nil {
+			log.Printf("adaptive throttle: error sampling broker throttling: %s\n", err)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.expireBadRates()
+
+	target := m.cfg.MaxReplicationLagSec
+	next, state, reason := m.nextRate(lag, target)
+
+	if max, err := m.headroom(); err == nil && next > max {
+		next = max
+		reason = fmt.Sprintf("%s (capped at replication headroom %.2fMB/s)", reason, max)
+	}
+
+	if state == lagStateEmergency {
+		m.badRates = append(m.badRates, badRate{
+			rate:     next,
+			expireAt: time.Now().Add(time.Duration(m.cfg.AgeBadRateAfterSec) * time.Second),
+		})
+	}
+
+	m.rate = next
+	m.lastTransition = replicationLagTransition{
+		State:       state,
+		Rate:        next,
+		TargetLag:   target,
+		ObservedLag: lag,
+		Reason:      reason,
+		Timestamp:   time.Now(),
+	}
+
+	cfg := ThrottleOverrideConfig{Rate: int(next)}
+	if err := setThrottleOverride(m.store, overrideRateZnodePath, cfg); err != nil {
+		log.Printf("adaptive throttle: error setting override: %s\n", err)
+		return
+	}
+
+	m.lastWrittenRate = cfg.Rate
+	m.haveLastWrittenRate = true
+
+	metrics.recordOverrideUpdate("global", next)
+}
+
+// onExternalOverride adopts an override change observed via m.watch as the
+// module's current rate, so the next tick adjusts from what's actually
+// live rather than silently clobbering an operator's manual override with a
+// stale in-memory rate. Since the module is itself a subscriber on the key
+// it writes, most events it sees are its own tick's write echoed back; those
+// are identified by matching lastWrittenRate and ignored rather than
+// misreported as an external change.
+func (m *replicationLagModule) onExternalOverride(ev ThrottleStoreEvent) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.haveLastWrittenRate && ev.Config.Rate == m.lastWrittenRate {
+		return
+	}
+
+	next := float64(ev.Config.Rate)
+	if next == m.rate {
+		return
+	}
+
+	log.Printf("adaptive throttle: observed external override change to %dMB/s, adopting as current rate\n", ev.Config.Rate)
+	m.rate = next
+}
+
+// nextRate classifies the observed lag against target and returns the next
+// rate, the state it transitioned to, and a human readable reason.
+func (m *replicationLagModule) nextRate(lag, target float64) (float64, replicationLagState, string) {
+	switch {
+	case lag >= target:
+		next := m.rate * 0.5
+		return next, lagStateEmergency, fmt.Sprintf("observed lag %.2fs reached/exceeded max %.2fs, cutting rate to %.2fMB/s", lag, target, next)
+	case lag >= target*m.cfg.EmergencyDecreaseThreshold:
+		next := m.rate * (lag / target)
+		return next, lagStateDecrease, fmt.Sprintf("observed lag %.2fs above decrease threshold, backing off to %.2fMB/s", lag, next)
+	case lag < target*m.cfg.MaxRateApproachThreshold && !m.rateIsBad(m.rate*1.1):
+		next := m.rate * 1.1
+		return next, lagStateIncrease, fmt.Sprintf("observed lag %.2fs well under max, probing rate up to %.2fMB/s", lag, next)
+	default:
+		return m.rate, lagStateHold, fmt.Sprintf("observed lag %.2fs within tolerance, holding rate at %.2fMB/s", lag, m.rate)
+	}
+}
+
+// rateIsBad returns whether rate matches a remembered bad rate that hasn't
+// yet aged out.
+func (m *replicationLagModule) rateIsBad(rate float64) bool {
+	for _, b := range m.badRates {
+		if b.rate == rate && time.Now().Before(b.expireAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// expireBadRates drops bad rates whose age-out time has passed. Callers
+// must hold m.Mutex.
+func (m *replicationLagModule) expireBadRates() {
+	fresh := m.badRates[:0]
+	for _, b := range m.badRates {
+		if time.Now().Before(b.expireAt) {
+			fresh = append(fresh, b)
+		}
+	}
+	m.badRates = fresh
+}
+
+// adaptiveStatus is the JSON representation returned by GET /throttle/adaptive.
+type adaptiveStatus struct {
+	Enabled    bool                       `json:"enabled"`
+	Config     ReplicationLagModuleConfig `json:"config"`
+	Transition replicationLagTransition   `json:"last_transition"`
+}
+
+// adaptiveGetSet handles GET (current state) and POST (enable/disable and
+// reconfigure) on /throttle/adaptive.
+func adaptiveGetSet(w http.ResponseWriter, req *http.Request, m *replicationLagModule) {
+	logReq(req)
+
+	switch req.Method {
+	case http.MethodGet:
+		m.Lock()
+		s := adaptiveStatus{
+			Enabled:    m.cfg.Enabled,
+			Config:     m.cfg,
+			Transition: m.lastTransition,
+		}
+		m.Unlock()
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			io.WriteString(w, fmt.Sprintf("%s\n", err))
+			return
+		}
+		w.Write(b)
+	case http.MethodPost:
+		// Decode onto a copy of the existing config rather than a zero
+		// value, so a partial POST (e.g. {"enabled": true} to toggle the
+		// module back on) merges onto what's already configured instead of
+		// zeroing every field the caller didn't specify.
+		m.Lock()
+		cfg := m.cfg
+		m.Unlock()
+
+		if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+			io.WriteString(w, fmt.Sprintf("%s\n", err))
+			return
+		}
+
+		if cfg.Enabled && cfg.MaxReplicationLagSec <= 0 {
+			io.WriteString(w, "MaxReplicationLagSec must be > 0\n")
+			return
+		}
+
+		if cfg.Enabled && cfg.Interval <= 0 {
+			// time.NewTicker panics on a non-positive duration, and Interval
+			// is easy to omit from a partial POST (e.g. {"enabled": true})
+			// that's only toggling the module back on.
+			io.WriteString(w, "Interval must be > 0\n")
+			return
+		}
+
+		m.Lock()
+		wasEnabled := m.cfg.Enabled
+		m.cfg = cfg
+		if cfg.InitialRate > 0 {
+			m.rate = cfg.InitialRate
+		}
+		m.Unlock()
+
+		if cfg.Enabled && !wasEnabled {
+			m.Start()
+		} else if !cfg.Enabled && wasEnabled {
+			m.Stop()
+		}
+
+		io.WriteString(w, "adaptive throttle configuration updated\n")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, incorrectMethod)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLagModule() *replicationLagModule {
+	cfg := ReplicationLagModuleConfig{
+		Enabled:                    true,
+		MaxReplicationLagSec:       100,
+		InitialRate:                50,
+		MaxRateApproachThreshold:   0.3,
+		EmergencyDecreaseThreshold: 0.7,
+		AgeBadRateAfterSec:         60,
+	}
+
+	return newReplicationLagModule(cfg, newMemoryThrottleStore(), nil, nil, nil)
+}
+
+func TestNextRateHoldsWithinTolerance(t *testing.T) {
+	m := newTestLagModule()
+
+	rate, state, _ := m.nextRate(50, m.cfg.MaxReplicationLagSec)
+	if state != lagStateHold {
+		t.Fatalf("state = %s, want %s", state, lagStateHold)
+	}
+	if rate != m.rate {
+		t.Fatalf("rate = %f, want unchanged %f", rate, m.rate)
+	}
+}
+
+func TestNextRateIncreasesWellUnderMax(t *testing.T) {
+	m := newTestLagModule()
+
+	rate, state, _ := m.nextRate(10, m.cfg.MaxReplicationLagSec)
+	if state != lagStateIncrease {
+		t.Fatalf("state = %s, want %s", state, lagStateIncrease)
+	}
+	if want := m.rate * 1.1; rate != want {
+		t.Fatalf("rate = %f, want %f", rate, want)
+	}
+}
+
+func TestNextRateDecreasesAboveThreshold(t *testing.T) {
+	m := newTestLagModule()
+
+	lag := m.cfg.MaxReplicationLagSec * 0.8
+	rate, state, _ := m.nextRate(lag, m.cfg.MaxReplicationLagSec)
+	if state != lagStateDecrease {
+		t.Fatalf("state = %s, want %s", state, lagStateDecrease)
+	}
+	if want := m.rate * (lag / m.cfg.MaxReplicationLagSec); rate != want {
+		t.Fatalf("rate = %f, want %f", rate, want)
+	}
+}
+
+func TestNextRateCutsOnEmergency(t *testing.T) {
+	m := newTestLagModule()
+
+	rate, state, _ := m.nextRate(m.cfg.MaxReplicationLagSec, m.cfg.MaxReplicationLagSec)
+	if state != lagStateEmergency {
+		t.Fatalf("state = %s, want %s", state, lagStateEmergency)
+	}
+	if want := m.rate * 0.5; rate != want {
+		t.Fatalf("rate = %f, want %f", rate, want)
+	}
+}
+
+func TestRateIsBadExpires(t *testing.T) {
+	m := newTestLagModule()
+
+	m.badRates = append(m.badRates, badRate{rate: 25, expireAt: time.Now().Add(-time.Second)})
+	m.badRates = append(m.badRates, badRate{rate: 40, expireAt: time.Now().Add(time.Minute)})
+
+	if m.rateIsBad(25) {
+		t.Fatal("expected expired bad rate to no longer be considered bad")
+	}
+	if !m.rateIsBad(40) {
+		t.Fatal("expected unexpired bad rate to still be considered bad")
+	}
+
+	m.expireBadRates()
+	if len(m.badRates) != 1 || m.badRates[0].rate != 40 {
+		t.Fatalf("expireBadRates left %v, want only the unexpired entry", m.badRates)
+	}
+}
+
+func TestOnExternalOverrideIgnoresItsOwnWrite(t *testing.T) {
+	m := newTestLagModule()
+	m.rate = 54.3
+	m.lastWrittenRate = 54
+	m.haveLastWrittenRate = true
+
+	// This mirrors the event the module's own tick() would see echoed back
+	// through its own watch subscription: the same (truncated) rate it just
+	// wrote.
+	m.onExternalOverride(ThrottleStoreEvent{Config: ThrottleOverrideConfig{Rate: 54}})
+
+	if m.rate != 54.3 {
+		t.Fatalf("rate = %f, want unchanged 54.3 (event should have been ignored as self-originated)", m.rate)
+	}
+}
+
+func TestOnExternalOverrideAdoptsGenuineExternalChange(t *testing.T) {
+	m := newTestLagModule()
+	m.rate = 54.3
+	m.lastWrittenRate = 54
+	m.haveLastWrittenRate = true
+
+	m.onExternalOverride(ThrottleStoreEvent{Config: ThrottleOverrideConfig{Rate: 20}})
+
+	if m.rate != 20 {
+		t.Fatalf("rate = %f, want 20 (operator-initiated override should be adopted)", m.rate)
+	}
+}
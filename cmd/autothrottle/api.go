@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -15,6 +16,30 @@ type APIConfig struct {
 	Listen      string
 	ZKPrefix    string
 	RateSetting string
+	// AdaptiveThrottle configures the optional replication-lag driven
+	// adaptive throttle module.
+	AdaptiveThrottle ReplicationLagModuleConfig
+	// LagFunc returns the current observed replica lag in seconds; required
+	// if AdaptiveThrottle.Enabled is true.
+	LagFunc func() (float64, error)
+	// HeadroomFunc returns the upper bound rate (MB/s), typically sourced
+	// from Limits.replicationHeadroom, that the adaptive module may not
+	// exceed.
+	HeadroomFunc func() (float64, error)
+	// BrokerSampleFunc, if set, is called by the adaptive module once per
+	// tick to sample broker-side throttle_time_ms via a
+	// brokerthrottle.Recorder (see the brokerthrottle package).
+	BrokerSampleFunc func() error
+	// RateLimit configures the per-client GCRA rate limiter applied to
+	// every admin API route. A zero value (PerSec == 0) disables rate
+	// limiting.
+	RateLimit RateLimitSettings
+	// StoreBackend selects the ThrottleStore implementation: "zk" (the
+	// default), "memory", or "redis".
+	StoreBackend string
+	// RedisAddr is the Redis instance address, required when StoreBackend
+	// is "redis".
+	RedisAddr string
 }
 
 var (
@@ -29,53 +54,83 @@ func initAPI(c *APIConfig, zk kafkazk.Handler) {
 
 	m := http.NewServeMux()
 
-	// Check ZK for override rate config znode.
-	exists, err := zk.Exists(overrideRateZnodePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if !exists {
-		// Create chroot.
-		err = zk.Create("/"+c.ZKPrefix, "")
+	// Wrap every route registration in the GCRA rate limit middleware. This
+	// guards against a runaway operator script hammering the store through
+	// setThrottleOverride. A zero PerSec disables limiting.
+	handle := func(pattern string, h http.HandlerFunc) { m.HandleFunc(pattern, h) }
+	if c.RateLimit.PerSec > 0 {
+		limiter, err := newGCRALimiter(c.RateLimit)
 		if err != nil {
 			log.Fatal(err)
 		}
-		// Create overrideZKPath.
-		err = zk.Create(overrideRateZnodePath, "")
+		handle = func(pattern string, h http.HandlerFunc) { m.HandleFunc(pattern, limiter.rateLimited(h)) }
+	}
+
+	if c.StoreBackend == "" || c.StoreBackend == "zk" {
+		// Check ZK for override rate config znode. This migration only
+		// applies to the ZK backend; other backends start with no legacy
+		// data to consider.
+		exists, err := zk.Exists(overrideRateZnodePath)
 		if err != nil {
 			log.Fatal(err)
 		}
-	}
 
-	// If the znode exists, check if it's using the legacy (non-json) format.
-	// If it is, update it to the json format.
-	// TODO(jamie): we can probably remove this by now.
-	if exists {
-		r, _ := zk.Get(overrideRateZnodePath)
-		if rate, err := strconv.Atoi(string(r)); err == nil {
-			// Populate the updated config.
-			err := setThrottleOverride(zk, overrideRateZnodePath, ThrottleOverrideConfig{Rate: rate})
+		if !exists {
+			// Create chroot.
+			err = zk.Create("/"+c.ZKPrefix, "")
 			if err != nil {
 				log.Fatal(err)
 			}
+			// Create overrideZKPath.
+			err = zk.Create(overrideRateZnodePath, "")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 
-			log.Println("Throttle override config format updated")
+		// If the znode exists, check if it's using the legacy (non-json) format.
+		// If it is, update it to the json format.
+		// TODO(jamie): we can probably remove this by now.
+		if exists {
+			r, _ := zk.Get(overrideRateZnodePath)
+			if rate, err := strconv.Atoi(string(r)); err == nil {
+				// Populate the updated config.
+				data, _ := json.Marshal(ThrottleOverrideConfig{Rate: rate})
+				if err := zk.Set(overrideRateZnodePath, string(data)); err != nil {
+					log.Fatal(err)
+				}
+
+				log.Println("Throttle override config format updated")
+			}
 		}
 	}
 
+	store, err := newThrottleStore(c, zk)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Routes. A global rate vs broker-specific rate is distinguished in whether
 	// or not there's a trailing slash (and in a properly formed request, the
 	// addition of a broker ID in the request path).
-	m.HandleFunc("/throttle", func(w http.ResponseWriter, req *http.Request) { throttleGetSet(w, req, zk) })
-	m.HandleFunc("/throttle/", func(w http.ResponseWriter, req *http.Request) { throttleGetSet(w, req, zk) })
-	m.HandleFunc("/throttle/remove", func(w http.ResponseWriter, req *http.Request) { throttleRemove(w, req, zk) })
-	m.HandleFunc("/throttle/remove/", func(w http.ResponseWriter, req *http.Request) { throttleRemove(w, req, zk) })
+	handle("/throttle", func(w http.ResponseWriter, req *http.Request) { throttleGetSet(w, req, store) })
+	handle("/throttle/", func(w http.ResponseWriter, req *http.Request) { throttleGetSet(w, req, store) })
+	handle("/throttle/remove", func(w http.ResponseWriter, req *http.Request) { throttleRemove(w, req, store) })
+	handle("/throttle/remove/", func(w http.ResponseWriter, req *http.Request) { throttleRemove(w, req, store) })
 
 	// Deprecated routes.
-	m.HandleFunc("/get_throttle", func(w http.ResponseWriter, req *http.Request) { getThrottleDeprecated(w, req, zk) })
-	m.HandleFunc("/set_throttle", func(w http.ResponseWriter, req *http.Request) { setThrottleDeprecated(w, req, zk) })
-	m.HandleFunc("/remove_throttle", func(w http.ResponseWriter, req *http.Request) { removeThrottleDeprecated(w, req, zk) })
+	handle("/get_throttle", func(w http.ResponseWriter, req *http.Request) { getThrottleDeprecated(w, req, store) })
+	handle("/set_throttle", func(w http.ResponseWriter, req *http.Request) { setThrottleDeprecated(w, req, store) })
+	handle("/remove_throttle", func(w http.ResponseWriter, req *http.Request) { removeThrottleDeprecated(w, req, store) })
+
+	// Adaptive throttle module, driven by observed replication lag rather
+	// than a static override rate. Disabled by default.
+	lagModule := newReplicationLagModule(c.AdaptiveThrottle, store, c.LagFunc, c.HeadroomFunc, c.BrokerSampleFunc)
+	lagModule.Start()
+	handle("/throttle/adaptive", func(w http.ResponseWriter, req *http.Request) { adaptiveGetSet(w, req, lagModule) })
+
+	// Prometheus metrics.
+	registerMetricsRoute(handle)
 
 	// Start listener.
 	go func() {
@@ -87,16 +142,16 @@ func initAPI(c *APIConfig, zk kafkazk.Handler) {
 }
 
 // throttleGetSet conditionally handles the request depending on the HTTP method.
-func throttleGetSet(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
+func throttleGetSet(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
 	logReq(req)
 
 	switch req.Method {
 	case http.MethodGet:
 		// Get a throttle rate.
-		getThrottle(w, req, zk)
+		getThrottle(w, req, store)
 	case http.MethodPost:
 		// Set a throttle rate.
-		setThrottle(w, req, zk)
+		setThrottle(w, req, store)
 	default:
 		// Invalid method.
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -106,13 +161,13 @@ func throttleGetSet(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler
 }
 
 // throttleRemove removes either the global or broker-specific throttle.
-func throttleRemove(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
+func throttleRemove(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
 	logReq(req)
 
 	switch req.Method {
 	case http.MethodPost:
 		// Remove the throttle.
-		removeThrottle(w, req, zk)
+		removeThrottle(w, req, store)
 	default:
 		// Invalid method.
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -121,26 +176,66 @@ func throttleRemove(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler
 	}
 }
 
-// getThrottle sets a throtle rate that applies to all brokers.
-func getThrottle(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
-	r, err := getThrottleOverride(zk, overrideRateZnodePath)
+// getThrottle returns the throttle rate for a single broker (if a broker ID
+// is present in the request path, falling back to the global override), or,
+// for a request with no broker ID, the global override plus a list of
+// active broker-specific overrides.
+func getThrottle(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
+	global, err := getThrottleOverride(store, overrideRateZnodePath)
 	if err != nil {
 		io.WriteString(w, err.Error())
 		return
 	}
 
-	switch r.Rate {
-	case 0:
-		io.WriteString(w, "no throttle override is set\n")
-	default:
-		resp := fmt.Sprintf("a throttle override is configured at %dMB/s, autoremove==%v\n",
-			r.Rate, r.AutoRemove)
-		io.WriteString(w, resp)
+	if id, ok := brokerIDFromPaths(parsePaths(req)); ok {
+		r, err := getThrottleOverride(store, brokerOverrideZnodePath(id))
+		if err != nil {
+			io.WriteString(w, err.Error())
+			return
+		}
+
+		if r.Rate == 0 {
+			// No broker-specific override; fall back to the global one.
+			r = global
+		}
+
+		if r.Rate == 0 {
+			io.WriteString(w, "no throttle override is set\n")
+			return
+		}
+
+		io.WriteString(w, fmt.Sprintf("a throttle override is configured at %dMB/s, autoremove==%v\n",
+			r.Rate, r.AutoRemove))
+		return
+	}
+
+	overrides, err := activeBrokerOverrides(store)
+	if err != nil {
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	if global.Rate == 0 {
+		io.WriteString(w, "no global throttle override is set\n")
+	} else {
+		io.WriteString(w, fmt.Sprintf("a global throttle override is configured at %dMB/s, autoremove==%v\n",
+			global.Rate, global.AutoRemove))
+	}
+
+	if len(overrides) == 0 {
+		io.WriteString(w, "no broker-specific overrides are set\n")
+		return
+	}
+
+	for id, r := range overrides {
+		io.WriteString(w, fmt.Sprintf("broker %d: %dMB/s, autoremove==%v\n", id, r.Rate, r.AutoRemove))
 	}
 }
 
-// setThrottle returns the throttle rate applied to all brokers.
-func setThrottle(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
+// setThrottle sets a throttle override. If the request path includes a
+// broker ID, the override applies only to that broker; otherwise it's the
+// global override applied to all brokers.
+func setThrottle(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
 	// Check rate param.
 	rate, err := parseRateParam(req)
 	if err != nil {
@@ -162,29 +257,37 @@ func setThrottle(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
 	}
 
 	// Determine whether this is a global or broker-specific override.
-	paths := parsePaths(req)
+	path, label := overridePathFromRequest(req)
 
 	// Set the config.
-	err = setThrottleOverride(zk, overrideRateZnodePath, rateCfg)
+	err = setThrottleOverride(store, path, rateCfg)
 	if err != nil {
 		io.WriteString(w, fmt.Sprintf("%s\n", err))
 	} else {
+		metrics.recordOverrideUpdate(label, float64(rate))
 		io.WriteString(w, fmt.Sprintf("throttle successfully set to %dMB/s, autoremove==%v\n",
 			rate, autoRemove))
 	}
 }
 
-// removeThrottle removes the throttle rate applied to all brokers.
-func removeThrottle(w http.ResponseWriter, req *http.Request, zk kafkazk.Handler) {
-	c := ThrottleOverrideConfig{
-		Rate:       0,
-		AutoRemove: false,
+// removeThrottle removes a throttle override. If the request path includes
+// a broker ID, the broker-specific key is deleted outright; otherwise the
+// global override is zeroed rather than deleted (the broker-specific keys
+// live beneath the global key).
+func removeThrottle(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
+	path, label := overridePathFromRequest(req)
+
+	var err error
+	if id, ok := brokerIDFromPaths(parsePaths(req)); ok {
+		err = deleteThrottleOverride(store, brokerOverrideZnodePath(id))
+	} else {
+		err = setThrottleOverride(store, path, ThrottleOverrideConfig{})
 	}
 
-	err := setThrottleOverride(zk, overrideRateZnodePath, c)
 	if err != nil {
 		io.WriteString(w, fmt.Sprintf("%s\n", err))
 	} else {
+		metrics.recordOverrideRemoval(label)
 		io.WriteString(w, "throttle successfully removed\n")
 	}
 }
@@ -78,7 +78,10 @@ func (l Limits) headroom(b *kafkametrics.Broker, t float64) (float64, error) {
 		// headroom.
 		overCap := math.Max(b.NetTX-capacity, 0.00)
 
-		return math.Max((capacity-nonThrottleUtil-overCap)*(l["maximum"]/100), l["minimum"]), nil
+		h := math.Max((capacity-nonThrottleUtil-overCap)*(l["maximum"]/100), l["minimum"])
+		metrics.recordReplicationHeadroom(h)
+
+		return h, nil
 	}
 
 	return l["minimum"], errors.New("Unknown instance type")
@@ -116,7 +119,10 @@ func (l Limits) replicationHeadroom(b *kafkametrics.Broker, rt replicaType, prev
 		// headroom.
 		overCap := math.Max(currNetUtilization-capacity, 0.00)
 
-		return math.Max((capacity-nonThrottleUtil-overCap)*(maxRatio/100), l["minimum"]), nil
+		h := math.Max((capacity-nonThrottleUtil-overCap)*(maxRatio/100), l["minimum"])
+		metrics.recordReplicationHeadroom(h)
+
+		return h, nil
 	}
 
 	return l["minimum"], errors.New("Unknown instance type")
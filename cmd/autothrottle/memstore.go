@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// memoryThrottleStore is an in-process ThrottleStore implementation. It's
+// primarily intended for tests, where it lets the admin API be exercised
+// without a running ZooKeeper, but it also works as a real (non-shared)
+// backend for a single autothrottle instance.
+type memoryThrottleStore struct {
+	mu   sync.Mutex
+	data map[string]ThrottleOverrideConfig
+
+	watchersMu sync.Mutex
+	watchers   map[string][]chan ThrottleStoreEvent
+	closed     bool
+}
+
+// newMemoryThrottleStore returns an empty memoryThrottleStore.
+func newMemoryThrottleStore() *memoryThrottleStore {
+	return &memoryThrottleStore{
+		data:     make(map[string]ThrottleOverrideConfig),
+		watchers: make(map[string][]chan ThrottleStoreEvent),
+	}
+}
+
+func (s *memoryThrottleStore) Get(key string) (ThrottleOverrideConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data[key], nil
+}
+
+func (s *memoryThrottleStore) Set(key string, cfg ThrottleOverrideConfig) error {
+	s.mu.Lock()
+	s.data[key] = cfg
+	s.mu.Unlock()
+
+	s.notify(key, cfg)
+
+	return nil
+}
+
+func (s *memoryThrottleStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.data, key)
+	s.mu.Unlock()
+
+	s.notify(key, ThrottleOverrideConfig{})
+
+	return nil
+}
+
+func (s *memoryThrottleStore) List(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for k := range s.data {
+		rest := strings.TrimPrefix(k, prefix+"/")
+		if rest == k || strings.Contains(rest, "/") {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (s *memoryThrottleStore) Watch(key string) <-chan ThrottleStoreEvent {
+	ch := make(chan ThrottleStoreEvent, 1)
+
+	s.watchersMu.Lock()
+	if s.closed {
+		s.watchersMu.Unlock()
+		close(ch)
+		return ch
+	}
+	s.watchers[key] = append(s.watchers[key], ch)
+	s.watchersMu.Unlock()
+
+	return ch
+}
+
+// Close closes every outstanding Watch channel. Subsequent Watch calls
+// return an already-closed channel.
+func (s *memoryThrottleStore) Close() error {
+	s.watchersMu.Lock()
+	defer s.watchersMu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for _, chans := range s.watchers {
+		for _, ch := range chans {
+			close(ch)
+		}
+	}
+	s.watchers = nil
+
+	return nil
+}
+
+// notify delivers cfg to every watcher registered on key. Sends are
+// non-blocking; a watcher that isn't keeping up misses intermediate
+// updates rather than stalling the writer.
+func (s *memoryThrottleStore) notify(key string, cfg ThrottleOverrideConfig) {
+	s.watchersMu.Lock()
+	defer s.watchersMu.Unlock()
+
+	ev := ThrottleStoreEvent{Key: key, Config: cfg}
+	for _, ch := range s.watchers[key] {
+		select {
+		case ch <- ev:
+		default:
+			// Replace the unread (older) event so the latest one is kept.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
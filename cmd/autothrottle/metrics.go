@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors published by the admin API.
+// It's a package-level singleton, similar to overrideRateZnodePath, since
+// there's exactly one of these per autothrottle process.
+var metrics = newThrottleMetrics()
+
+// throttleMetrics groups the collectors instrumenting throttle decisions and
+// the replication headroom calculations that feed them.
+type throttleMetrics struct {
+	rateMbps                *prometheus.GaugeVec
+	overrideUpdatesTotal    prometheus.Counter
+	overrideRemovalsTotal   prometheus.Counter
+	replicationHeadroomHist prometheus.Histogram
+}
+
+// newThrottleMetrics constructs and registers the throttle collectors
+// against the default Prometheus registry.
+func newThrottleMetrics() *throttleMetrics {
+	m := &throttleMetrics{
+		rateMbps: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_kit_throttle_rate_mbps",
+			Help: "Current throttle rate in MB/s, labeled by broker id (or \"global\" for the override).",
+		}, []string{"broker"}),
+		overrideUpdatesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_kit_throttle_override_updates_total",
+			Help: "Count of throttle override writes.",
+		}),
+		overrideRemovalsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_kit_throttle_override_removals_total",
+			Help: "Count of throttle override removals.",
+		}),
+		replicationHeadroomHist: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "kafka_kit_replication_headroom_mbps",
+			Help:    "Replication headroom (MB/s) sampled on every calculation.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+	}
+
+	prometheus.MustRegister(m.rateMbps, m.overrideUpdatesTotal, m.overrideRemovalsTotal, m.replicationHeadroomHist)
+
+	return m
+}
+
+// recordOverrideUpdate records a throttle override write for broker (use
+// "global" for the non-broker-specific override).
+func (t *throttleMetrics) recordOverrideUpdate(broker string, rate float64) {
+	t.rateMbps.WithLabelValues(broker).Set(rate)
+	t.overrideUpdatesTotal.Inc()
+}
+
+// recordOverrideRemoval records a throttle override removal for broker.
+func (t *throttleMetrics) recordOverrideRemoval(broker string) {
+	t.rateMbps.WithLabelValues(broker).Set(0)
+	t.overrideRemovalsTotal.Inc()
+}
+
+// recordReplicationHeadroom samples a single replication headroom
+// calculation, in MB/s.
+func (t *throttleMetrics) recordReplicationHeadroom(v float64) {
+	t.replicationHeadroomHist.Observe(v)
+}
+
+// registerMetricsRoute exposes the default Prometheus registry, which also
+// carries the broker throttling histogram recorded by the brokerthrottle
+// package's Recorder (a *sarama.Broker wrapper), on the admin listener at
+// /metrics.
+func registerMetricsRoute(handle func(string, http.HandlerFunc)) {
+	handle("/metrics", promhttp.Handler().ServeHTTP)
+}
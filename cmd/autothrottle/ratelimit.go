@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitSettings configures the per-client rate limiter applied to the
+// admin API. It's enforced with the Generic Cell Rate Algorithm (GCRA),
+// which allows bursts up to MaxBurst while smoothing the sustained rate to
+// PerSec.
+type RateLimitSettings struct {
+	// PerSec is the sustained number of requests allowed per second, per
+	// client key.
+	PerSec float64
+	// MaxBurst is the number of requests a client may make in a burst
+	// before being rate limited.
+	MaxBurst int
+	// MemoryStoreSize caps the number of distinct client keys tracked in
+	// the in-memory GCRA store. Once exceeded, the oldest idle entries are
+	// evicted.
+	MemoryStoreSize int
+	// VaryByRemoteAddr includes the request's remote address in the client
+	// key.
+	VaryByRemoteAddr bool
+	// VaryByHeader, if set, includes the named header's value in the
+	// client key (e.g. an API key or operator identity header).
+	VaryByHeader string
+}
+
+// gcraResult is the outcome of evaluating a single cell (request) against a
+// client's GCRA state.
+type gcraResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration
+	resetAfter time.Duration
+}
+
+// gcraLimiter enforces RateLimitSettings using the Generic Cell Rate
+// Algorithm. Per-key state is a single "theoretical arrival time" (tat);
+// this makes the store cheap, since there's nothing to periodically refill
+// the way a token bucket requires.
+type gcraLimiter struct {
+	sync.Mutex
+
+	settings RateLimitSettings
+
+	emissionInterval time.Duration
+	burstOffset      time.Duration
+
+	tat map[string]time.Time
+}
+
+// newGCRALimiter returns a gcraLimiter configured per settings.
+func newGCRALimiter(settings RateLimitSettings) (*gcraLimiter, error) {
+	if settings.MemoryStoreSize <= 0 {
+		// len(g.tat) >= settings.MemoryStoreSize gates eviction in allow; a
+		// zero value makes that comparison true on every request, capping
+		// the tracked-key set at ~1 and silently defeating per-client limits
+		// for everyone but the most recent caller.
+		return nil, errors.New("MemoryStoreSize must be > 0")
+	}
+
+	emissionInterval := time.Duration(float64(time.Second) / settings.PerSec)
+
+	return &gcraLimiter{
+		settings:         settings,
+		emissionInterval: emissionInterval,
+		burstOffset:      emissionInterval * time.Duration(settings.MaxBurst),
+		tat:              make(map[string]time.Time),
+	}, nil
+}
+
+// allow evaluates a single cell for key against the limiter, updating the
+// key's stored tat if the cell is allowed.
+func (g *gcraLimiter) allow(key string) gcraResult {
+	g.Lock()
+	defer g.Unlock()
+
+	now := time.Now()
+
+	tat, ok := g.tat[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(g.emissionInterval)
+	allowAt := newTat.Add(-g.burstOffset)
+
+	if allowAt.After(now) {
+		return gcraResult{
+			allowed:    false,
+			limit:      g.settings.MaxBurst,
+			remaining:  0,
+			retryAfter: allowAt.Sub(now),
+			resetAfter: newTat.Sub(now),
+		}
+	}
+
+	if len(g.tat) >= g.settings.MemoryStoreSize {
+		g.evictOldest()
+	}
+
+	g.tat[key] = newTat
+
+	remaining := int(g.burstOffset/g.emissionInterval) - int(newTat.Sub(now)/g.emissionInterval)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return gcraResult{
+		allowed:    true,
+		limit:      g.settings.MaxBurst,
+		remaining:  remaining,
+		resetAfter: newTat.Sub(now),
+	}
+}
+
+// evictOldest drops the client key with the earliest tat. Callers must hold
+// g.Mutex. This is an O(n) scan; MemoryStoreSize is expected to be small
+// enough (tens of thousands of client keys at most) that this is cheap
+// relative to eviction frequency.
+func (g *gcraLimiter) evictOldest() {
+	var oldestKey string
+	var oldestTat time.Time
+
+	for k, t := range g.tat {
+		if oldestKey == "" || t.Before(oldestTat) {
+			oldestKey, oldestTat = k, t
+		}
+	}
+
+	if oldestKey != "" {
+		delete(g.tat, oldestKey)
+	}
+}
+
+// clientKey derives the rate limit key for req per the limiter's settings.
+func (g *gcraLimiter) clientKey(req *http.Request) string {
+	var key string
+
+	if g.settings.VaryByRemoteAddr {
+		key += req.RemoteAddr
+	}
+
+	if g.settings.VaryByHeader != "" {
+		key += "|" + req.Header.Get(g.settings.VaryByHeader)
+	}
+
+	return key
+}
+
+// rateLimited wraps h so that every request is first checked against the
+// GCRA limiter. Requests over the limit get a 429 with Retry-After and
+// X-RateLimit-* headers populated from the GCRA result.
+func (g *gcraLimiter) rateLimited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		res := g.allow(g.clientKey(req))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.remaining))
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%.0f", res.resetAfter.Seconds()))
+
+		if !res.allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", res.retryAfter.Seconds()))
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "rate limit exceeded, retry after %.0fs\n", res.retryAfter.Seconds())
+			return
+		}
+
+		h(w, req)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGCRALimiterAllowsWithinBurst(t *testing.T) {
+	g, err := newGCRALimiter(RateLimitSettings{
+		PerSec:          1,
+		MaxBurst:        3,
+		MemoryStoreSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("newGCRALimiter: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		res := g.allow("client-a")
+		if !res.allowed {
+			t.Fatalf("request %d: expected allowed, got denied", i)
+		}
+	}
+}
+
+func TestGCRALimiterDeniesOverBurst(t *testing.T) {
+	g, err := newGCRALimiter(RateLimitSettings{
+		PerSec:          1,
+		MaxBurst:        2,
+		MemoryStoreSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("newGCRALimiter: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := g.allow("client-a"); !res.allowed {
+			t.Fatalf("request %d: expected allowed, got denied", i)
+		}
+	}
+
+	res := g.allow("client-a")
+	if res.allowed {
+		t.Fatal("expected request beyond burst to be denied")
+	}
+	if res.retryAfter <= 0 {
+		t.Fatalf("expected positive retryAfter, got %s", res.retryAfter)
+	}
+}
+
+func TestGCRALimiterKeysAreIndependent(t *testing.T) {
+	g, err := newGCRALimiter(RateLimitSettings{
+		PerSec:          1,
+		MaxBurst:        1,
+		MemoryStoreSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("newGCRALimiter: %s", err)
+	}
+
+	if res := g.allow("client-a"); !res.allowed {
+		t.Fatal("expected first request from client-a to be allowed")
+	}
+	if res := g.allow("client-a"); res.allowed {
+		t.Fatal("expected second request from client-a to be denied")
+	}
+	if res := g.allow("client-b"); !res.allowed {
+		t.Fatal("expected first request from client-b to be allowed regardless of client-a's state")
+	}
+}
+
+func TestGCRALimiterEvictsOldestWhenStoreFull(t *testing.T) {
+	g, err := newGCRALimiter(RateLimitSettings{
+		PerSec:          1,
+		MaxBurst:        1,
+		MemoryStoreSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("newGCRALimiter: %s", err)
+	}
+
+	g.allow("client-a")
+	g.allow("client-b")
+
+	if len(g.tat) != 2 {
+		t.Fatalf("expected 2 tracked keys, got %d", len(g.tat))
+	}
+
+	g.allow("client-c")
+
+	if len(g.tat) != 2 {
+		t.Fatalf("expected evictOldest to cap tracked keys at 2, got %d", len(g.tat))
+	}
+	if _, ok := g.tat["client-a"]; ok {
+		t.Fatal("expected client-a (the oldest key) to have been evicted")
+	}
+}
+
+func TestClientKeyCombinesConfiguredDimensions(t *testing.T) {
+	g, err := newGCRALimiter(RateLimitSettings{
+		VaryByRemoteAddr: true,
+		VaryByHeader:     "X-Operator",
+		MemoryStoreSize:  10,
+	})
+	if err != nil {
+		t.Fatalf("newGCRALimiter: %s", err)
+	}
+
+	req := httptest.NewRequest("GET", "/throttle", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Operator", "ops-alice")
+
+	if got, want := g.clientKey(req), "10.0.0.1:1234|ops-alice"; got != want {
+		t.Fatalf("clientKey() = %q, want %q", got, want)
+	}
+}
+
+func TestNewGCRALimiterRejectsUnsetMemoryStoreSize(t *testing.T) {
+	if _, err := newGCRALimiter(RateLimitSettings{PerSec: 1, MaxBurst: 5}); err == nil {
+		t.Fatal("expected an error for a zero-value MemoryStoreSize, got nil")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisThrottleStore is a ThrottleStore implementation backed by Redis,
+// analogous to how the throttled library abstracts rate limit state over a
+// memstore vs a redigostore. It lets multiple autothrottle instances share
+// override state without ZooKeeper.
+type redisThrottleStore struct {
+	pool   *redis.Pool
+	closed chan struct{}
+}
+
+// newRedisThrottleStore returns a ThrottleStore backed by the Redis
+// instance at addr.
+func newRedisThrottleStore(addr string) (*redisThrottleStore, error) {
+	pool := &redis.Pool{
+		MaxIdle:     8,
+		IdleTimeout: 240 * time.Second,
+		Dial:        func() (redis.Conn, error) { return redis.Dial("tcp", addr) },
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("PING"); err != nil {
+		return nil, fmt.Errorf("error connecting to redis at %s: %s", addr, err)
+	}
+
+	return &redisThrottleStore{pool: pool, closed: make(chan struct{})}, nil
+}
+
+func (s *redisThrottleStore) Get(key string) (ThrottleOverrideConfig, error) {
+	var cfg ThrottleOverrideConfig
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error unmarshalling override config at %s: %s", key, err)
+	}
+
+	return cfg, nil
+}
+
+func (s *redisThrottleStore) Set(key string, cfg ThrottleOverrideConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", key, data); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("PUBLISH", "throttle-store:"+key, data)
+
+	return err
+}
+
+func (s *redisThrottleStore) Delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", key); err != nil {
+		return err
+	}
+
+	_, err := conn.Do("PUBLISH", "throttle-store:"+key, "")
+
+	return err
+}
+
+func (s *redisThrottleStore) List(prefix string) ([]string, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	keys, err := redis.Strings(conn.Do("KEYS", prefix+"/*"))
+	if err != nil {
+		return nil, err
+	}
+
+	// KEYS' "*" also matches "/", so drop keys nested below a direct child.
+	direct := keys[:0]
+	for _, k := range keys {
+		if !strings.Contains(strings.TrimPrefix(k, prefix+"/"), "/") {
+			direct = append(direct, k)
+		}
+	}
+
+	return direct, nil
+}
+
+// Watch subscribes to the Redis pub/sub channel published to by Set and
+// Delete for key, translating messages into ThrottleStoreEvents.
+func (s *redisThrottleStore) Watch(key string) <-chan ThrottleStoreEvent {
+	out := make(chan ThrottleStoreEvent)
+
+	conn := s.pool.Get()
+	psc := redis.PubSubConn{Conn: conn}
+
+	go func() {
+		// Unblock psc.Receive below once the store is closed, since redigo
+		// has no way to interrupt a pub/sub read other than closing its
+		// connection out from under it.
+		<-s.closed
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(out)
+		defer conn.Close()
+
+		if err := psc.Subscribe("throttle-store:" + key); err != nil {
+			return
+		}
+
+		for {
+			switch v := psc.Receive().(type) {
+			case redis.Message:
+				var cfg ThrottleOverrideConfig
+				json.Unmarshal(v.Data, &cfg)
+				out <- ThrottleStoreEvent{Key: key, Config: cfg}
+			case error:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Close stops every in-flight Watch subscription and closes the underlying
+// connection pool. It's safe to call more than once.
+func (s *redisThrottleStore) Close() error {
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+
+	return s.pool.Close()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/kafka-kit/kafkazk"
+)
+
+// ThrottleStoreEvent is sent on a Watch channel when the config at Key
+// changes.
+type ThrottleStoreEvent struct {
+	Key    string
+	Config ThrottleOverrideConfig
+}
+
+// ThrottleStore abstracts the storage backend for throttle override
+// config, keyed by a logical path (e.g. "/<ZKPrefix>/override_rate" or
+// "/<ZKPrefix>/override_rate/brokers/1001"). This lets multiple autothrottle instances
+// share override state without ZooKeeper, and makes the admin API
+// unit-testable against an in-memory store.
+type ThrottleStore interface {
+	// Get returns the config stored at key. A key with nothing stored
+	// returns a zero-value ThrottleOverrideConfig and a nil error.
+	Get(key string) (ThrottleOverrideConfig, error)
+	// Set writes cfg to key, creating it if necessary.
+	Set(key string, cfg ThrottleOverrideConfig) error
+	// Delete removes key entirely.
+	Delete(key string) error
+	// List returns the full keys of all children directly under prefix.
+	List(prefix string) ([]string, error)
+	// Watch returns a channel that receives an event any time key is
+	// mutated, including by the watching caller itself, so a cached rate
+	// can be invalidated. The channel
+	// is closed when the store is closed.
+	Watch(key string) <-chan ThrottleStoreEvent
+	// Close releases any resources held by the store (background watch
+	// goroutines, pooled connections) and closes every outstanding Watch
+	// channel. The store must not be used after Close returns.
+	Close() error
+}
+
+// newThrottleStore constructs the ThrottleStore configured by
+// c.StoreBackend. zk is required for the "zk" backend (the default) and
+// ignored otherwise.
+func newThrottleStore(c *APIConfig, zk kafkazk.Handler) (ThrottleStore, error) {
+	switch c.StoreBackend {
+	case "", "zk":
+		return newZKThrottleStore(zk), nil
+	case "memory":
+		return newMemoryThrottleStore(), nil
+	case "redis":
+		return newRedisThrottleStore(c.RedisAddr)
+	default:
+		return nil, fmt.Errorf("unknown store backend: %s", c.StoreBackend)
+	}
+}
+
+// zkThrottleStore is the ThrottleStore implementation backed by ZooKeeper,
+// using the logical key directly as a znode path. It's the original and
+// default backend.
+type zkThrottleStore struct {
+	zk        kafkazk.Handler
+	watchPoll time.Duration
+	closed    chan struct{}
+}
+
+// newZKThrottleStore returns a ThrottleStore backed by zk.
+func newZKThrottleStore(zk kafkazk.Handler) *zkThrottleStore {
+	return &zkThrottleStore{zk: zk, watchPoll: 5 * time.Second, closed: make(chan struct{})}
+}
+
+func (s *zkThrottleStore) Get(key string) (ThrottleOverrideConfig, error) {
+	var cfg ThrottleOverrideConfig
+
+	exists, err := s.zk.Exists(key)
+	if err != nil {
+		return cfg, err
+	}
+	if !exists {
+		return cfg, nil
+	}
+
+	data, err := s.zk.Get(key)
+	if err != nil {
+		return cfg, err
+	}
+	if len(data) == 0 {
+		return cfg, nil
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error unmarshalling override config at %s: %s", key, err)
+	}
+
+	return cfg, nil
+}
+
+func (s *zkThrottleStore) Set(key string, cfg ThrottleOverrideConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.zk.Exists(key)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		if i := strings.LastIndex(key, "/"); i > 0 {
+			parent := key[:i]
+			if parentExists, err := s.zk.Exists(parent); err == nil && !parentExists {
+				if err := s.zk.Create(parent, ""); err != nil {
+					return err
+				}
+			}
+		}
+
+		return s.zk.Create(key, string(data))
+	}
+
+	return s.zk.Set(key, string(data))
+}
+
+func (s *zkThrottleStore) Delete(key string) error {
+	return s.zk.Delete(key)
+}
+
+func (s *zkThrottleStore) List(prefix string) ([]string, error) {
+	exists, err := s.zk.Exists(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	children, err := s.zk.Children(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(children))
+	for i, c := range children {
+		keys[i] = prefix + "/" + c
+	}
+
+	return keys, nil
+}
+
+// Watch polls the znode at key, since the kafkazk.Handler interface doesn't
+// expose ZooKeeper's native watch primitive. This is coarser than a true
+// watch but sufficient for invalidating a cached rate.
+func (s *zkThrottleStore) Watch(key string) <-chan ThrottleStoreEvent {
+	out := make(chan ThrottleStoreEvent)
+
+	go func() {
+		defer close(out)
+
+		last, _ := s.Get(key)
+
+		t := time.NewTicker(s.watchPoll)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				cur, err := s.Get(key)
+				if err != nil {
+					continue
+				}
+
+				if cur != last {
+					last = cur
+					out <- ThrottleStoreEvent{Key: key, Config: cur}
+				}
+			case <-s.closed:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Close stops every in-flight Watch poll loop. It's safe to call more than
+// once.
+func (s *zkThrottleStore) Close() error {
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// brokerOverrideZnode is the parent znode under which broker-specific
+// throttle overrides are stored, as children named by broker id.
+var brokerOverrideZnode = "brokers"
+
+// ThrottleOverrideConfig holds the throttle override rate and any
+// supplementary settings, stored as JSON at either the global override
+// znode or a broker-specific child znode.
+type ThrottleOverrideConfig struct {
+	// Rate is the throttle override rate in MB/s. A rate of 0 indicates no
+	// override is set.
+	Rate int `json:"rate"`
+	// AutoRemove indicates whether this override should be automatically
+	// removed once the replication it was set for completes.
+	AutoRemove bool `json:"autoremove"`
+}
+
+// logReq logs the method and path of an admin API request.
+func logReq(req *http.Request) {
+	log.Printf("%s %s\n", req.Method, req.URL.Path)
+}
+
+// parseRateParam parses the "rate" query param as a throttle rate in MB/s.
+func parseRateParam(req *http.Request) (int, error) {
+	r := req.URL.Query().Get("rate")
+	if r == "" {
+		return 0, fmt.Errorf("rate param required\n")
+	}
+
+	rate, err := strconv.Atoi(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate param: %s\n", err)
+	}
+
+	return rate, nil
+}
+
+// parseAutoRemoveParam parses the "autoremove" query param.
+func parseAutoRemoveParam(req *http.Request) (bool, error) {
+	a := req.URL.Query().Get("autoremove")
+	if a == "" {
+		return false, nil
+	}
+
+	autoRemove, err := strconv.ParseBool(a)
+	if err != nil {
+		return false, fmt.Errorf("invalid autoremove param: %s\n", err)
+	}
+
+	return autoRemove, nil
+}
+
+// parsePaths splits a request path on "/" and returns the non-empty
+// segments following the route prefix (e.g. "/throttle/1001" yields
+// ["1001"], "/throttle/remove/1001" yields ["remove", "1001"]).
+func parsePaths(req *http.Request) []string {
+	trimmed := strings.Trim(req.URL.Path, "/")
+
+	var paths []string
+	for _, p := range strings.Split(trimmed, "/") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+
+	// Drop the leading "throttle" route segment; callers only care about
+	// what follows it.
+	if len(paths) > 0 && paths[0] == "throttle" {
+		paths = paths[1:]
+	}
+
+	return paths
+}
+
+// brokerIDFromPaths returns the broker ID found in paths (the last segment,
+// skipping a leading "remove"), and whether one was present.
+func brokerIDFromPaths(paths []string) (int, bool) {
+	if len(paths) > 0 && paths[0] == "remove" {
+		paths = paths[1:]
+	}
+
+	if len(paths) == 0 {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(paths[len(paths)-1])
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// brokerOverrideZnodePath returns the znode path for a broker-specific
+// throttle override.
+func brokerOverrideZnodePath(id int) string {
+	return fmt.Sprintf("%s/%s/%d", overrideRateZnodePath, brokerOverrideZnode, id)
+}
+
+// overridePathFromRequest returns the znode path that a request targets
+// (the global override path, or a broker-specific child path if the
+// request includes a broker ID), along with a label suitable for metrics
+// ("global" or the broker ID).
+func overridePathFromRequest(req *http.Request) (path string, label string) {
+	if id, ok := brokerIDFromPaths(parsePaths(req)); ok {
+		return brokerOverrideZnodePath(id), strconv.Itoa(id)
+	}
+
+	return overrideRateZnodePath, "global"
+}
+
+// activeBrokerOverrides lists the broker IDs with an active (non-zero)
+// broker-specific throttle override. A reaper enforcing AutoRemove is
+// expected to iterate the global override alongside these independently,
+// since each key carries its own AutoRemove setting.
+func activeBrokerOverrides(store ThrottleStore) (map[int]ThrottleOverrideConfig, error) {
+	parent := fmt.Sprintf("%s/%s", overrideRateZnodePath, brokerOverrideZnode)
+
+	keys, err := store.List(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[int]ThrottleOverrideConfig, len(keys))
+	for _, k := range keys {
+		id, err := strconv.Atoi(k[strings.LastIndex(k, "/")+1:])
+		if err != nil {
+			continue
+		}
+
+		cfg, err := getThrottleOverride(store, k)
+		if err != nil || cfg.Rate == 0 {
+			continue
+		}
+
+		overrides[id] = cfg
+	}
+
+	return overrides, nil
+}
+
+// getThrottleOverride fetches the ThrottleOverrideConfig stored at key.
+func getThrottleOverride(store ThrottleStore, key string) (ThrottleOverrideConfig, error) {
+	return store.Get(key)
+}
+
+// setThrottleOverride writes cfg to key.
+func setThrottleOverride(store ThrottleStore, key string, cfg ThrottleOverrideConfig) error {
+	return store.Set(key, cfg)
+}
+
+// deleteThrottleOverride removes key entirely, used for broker-specific
+// overrides rather than zeroing the global rate.
+func deleteThrottleOverride(store ThrottleStore, key string) error {
+	return store.Delete(key)
+}
+
+// getThrottleDeprecated is the legacy plain-text equivalent of getThrottle,
+// retained for callers that haven't migrated to /throttle.
+func getThrottleDeprecated(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
+	getThrottle(w, req, store)
+}
+
+// setThrottleDeprecated is the legacy plain-text equivalent of setThrottle,
+// retained for callers that haven't migrated to /throttle.
+func setThrottleDeprecated(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
+	setThrottle(w, req, store)
+}
+
+// removeThrottleDeprecated is the legacy plain-text equivalent of
+// removeThrottle, retained for callers that haven't migrated to
+// /throttle/remove.
+func removeThrottleDeprecated(w http.ResponseWriter, req *http.Request, store ThrottleStore) {
+	removeThrottle(w, req, store)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func init() {
+	// getThrottle/setThrottle key their override paths off this package-level
+	// var, normally populated by initAPI.
+	overrideRateZnodePath = "/test-cluster/override_rate"
+}
+
+func TestParsePaths(t *testing.T) {
+	cases := []struct {
+		path string
+		want []string
+	}{
+		{"/throttle", []string{}},
+		{"/throttle/1001", []string{"1001"}},
+		{"/throttle/remove/1001", []string{"remove", "1001"}},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if got := parsePaths(req); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parsePaths(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestBrokerIDFromPaths(t *testing.T) {
+	cases := []struct {
+		paths  []string
+		wantID int
+		wantOK bool
+	}{
+		{nil, 0, false},
+		{[]string{"1001"}, 1001, true},
+		{[]string{"remove", "1001"}, 1001, true},
+		{[]string{"remove"}, 0, false},
+		{[]string{"not-an-id"}, 0, false},
+	}
+
+	for _, c := range cases {
+		id, ok := brokerIDFromPaths(c.paths)
+		if id != c.wantID || ok != c.wantOK {
+			t.Errorf("brokerIDFromPaths(%v) = (%d, %v), want (%d, %v)", c.paths, id, ok, c.wantID, c.wantOK)
+		}
+	}
+}
+
+func TestOverridePathFromRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/throttle/1001", nil)
+	path, label := overridePathFromRequest(req)
+	if want := brokerOverrideZnodePath(1001); path != want {
+		t.Errorf("path = %q, want %q", path, want)
+	}
+	if label != "1001" {
+		t.Errorf("label = %q, want %q", label, "1001")
+	}
+
+	req = httptest.NewRequest("POST", "/throttle", nil)
+	path, label = overridePathFromRequest(req)
+	if path != overrideRateZnodePath {
+		t.Errorf("path = %q, want %q", path, overrideRateZnodePath)
+	}
+	if label != "global" {
+		t.Errorf("label = %q, want %q", label, "global")
+	}
+}
+
+func TestBrokerOverrideFallsBackToGlobal(t *testing.T) {
+	store := newMemoryThrottleStore()
+
+	if err := setThrottleOverride(store, overrideRateZnodePath, ThrottleOverrideConfig{Rate: 50}); err != nil {
+		t.Fatalf("setThrottleOverride: %s", err)
+	}
+
+	// No broker-specific override has been set for 1001, so getThrottle
+	// falls back to the global rate.
+	global, err := getThrottleOverride(store, overrideRateZnodePath)
+	if err != nil {
+		t.Fatalf("getThrottleOverride: %s", err)
+	}
+
+	broker, err := getThrottleOverride(store, brokerOverrideZnodePath(1001))
+	if err != nil {
+		t.Fatalf("getThrottleOverride: %s", err)
+	}
+
+	if broker.Rate != 0 {
+		t.Fatalf("expected no broker-specific override, got rate %d", broker.Rate)
+	}
+	if global.Rate != 50 {
+		t.Fatalf("expected global rate 50, got %d", global.Rate)
+	}
+
+	rec := httptest.NewRecorder()
+	getThrottle(rec, httptest.NewRequest("GET", "/throttle/1001", nil), store)
+	if got, want := rec.Body.String(), "a throttle override is configured at 50MB/s, autoremove==false\n"; got != want {
+		t.Fatalf("getThrottle(/throttle/1001) = %q, want %q", got, want)
+	}
+}
+
+func TestActiveBrokerOverrides(t *testing.T) {
+	store := newMemoryThrottleStore()
+
+	if err := setThrottleOverride(store, brokerOverrideZnodePath(1001), ThrottleOverrideConfig{Rate: 40}); err != nil {
+		t.Fatalf("setThrottleOverride: %s", err)
+	}
+	if err := setThrottleOverride(store, brokerOverrideZnodePath(1002), ThrottleOverrideConfig{Rate: 60}); err != nil {
+		t.Fatalf("setThrottleOverride: %s", err)
+	}
+
+	overrides, err := activeBrokerOverrides(store)
+	if err != nil {
+		t.Fatalf("activeBrokerOverrides: %s", err)
+	}
+
+	if len(overrides) != 2 {
+		t.Fatalf("expected 2 broker overrides, got %d", len(overrides))
+	}
+	if overrides[1001].Rate != 40 {
+		t.Errorf("broker 1001 rate = %d, want 40", overrides[1001].Rate)
+	}
+	if overrides[1002].Rate != 60 {
+		t.Errorf("broker 1002 rate = %d, want 60", overrides[1002].Rate)
+	}
+}
+
+func TestDeleteThrottleOverride(t *testing.T) {
+	store := newMemoryThrottleStore()
+	key := brokerOverrideZnodePath(1001)
+
+	if err := setThrottleOverride(store, key, ThrottleOverrideConfig{Rate: 40}); err != nil {
+		t.Fatalf("setThrottleOverride: %s", err)
+	}
+	if err := deleteThrottleOverride(store, key); err != nil {
+		t.Fatalf("deleteThrottleOverride: %s", err)
+	}
+
+	cfg, err := getThrottleOverride(store, key)
+	if err != nil {
+		t.Fatalf("getThrottleOverride: %s", err)
+	}
+	if cfg.Rate != 0 {
+		t.Fatalf("expected deleted override to read back as zero value, got rate %d", cfg.Rate)
+	}
+}